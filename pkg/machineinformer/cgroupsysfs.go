@@ -0,0 +1,286 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machineinformer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/google/cadvisor/utils/sysfs"
+
+	"github.com/fromanirh/cpumgrx/pkg/tmutils"
+)
+
+const (
+	procSelfCgroup = "/proc/self/cgroup"
+	cgroupFsRoot   = "/sys/fs/cgroup"
+
+	cpusetEffectiveFileV2 = "cpuset.cpus.effective"
+	cpusetFileV1          = "cpuset.cpus"
+
+	memsEffectiveFileV2 = "cpuset.mems.effective"
+	memsFileV1          = "cpuset.mems"
+
+	memoryMaxFileV2      = "memory.max"
+	memoryLimitFileV1    = "memory.limit_in_bytes"
+	memoryUnlimitedValue = "max"
+)
+
+// cgroupAwareSysFs wraps another sysfs.SysFs and narrows what it reports down to the
+// CPUs, NUMA nodes and memory actually available to the current process, as constrained
+// by its cpuset and memory cgroup. Everything it does not override (caches, block and
+// network devices, ...) is delegated unchanged to the wrapped implementation.
+type cgroupAwareSysFs struct {
+	sysfs.SysFs
+
+	allowedCPUs  map[uint16]bool
+	allowedNodes map[string]bool
+
+	// memNodeBudgetBytes is the memory.max budget divided across the allowed NUMA
+	// nodes, so that summing every reported node never overstates the real cgroup
+	// budget. 0 means no limit was found.
+	memNodeBudgetBytes int64
+}
+
+// NewCgroupAwareSysFs returns a sysfs.SysFs that reports only the CPUs, NUMA nodes and
+// memory the current process is actually allowed to use, as constrained by its cpuset
+// and memory cgroup (v2 unified hierarchy, falling back to v1). If the cgroup limits
+// cannot be determined, it behaves exactly like NewRelocatableSysFs(root).
+func NewCgroupAwareSysFs(root string) sysfs.SysFs {
+	fs := &cgroupAwareSysFs{SysFs: NewRelocatableSysFs(root)}
+	if err := fs.loadCgroupLimits(root); err != nil {
+		klog.V(2).Infof("cgroup-aware sysfs: could not determine cgroup limits, falling back to host view: %v", err)
+		// drop any limit recorded before the failure, so the view is the host's in full
+		fs = &cgroupAwareSysFs{SysFs: fs.SysFs}
+	}
+	return fs
+}
+
+// loadCgroupLimits locates the cpuset and memory controllers for the current process
+// and records the CPUs, NUMA nodes and memory budget they allow.
+func (fs *cgroupAwareSysFs) loadCgroupLimits(root string) error {
+	v2Path, v1Paths, err := currentCgroupPaths(filepath.Join(root, procSelfCgroup))
+	if err != nil {
+		return err
+	}
+
+	cpuList, memList, memMax, err := readCgroupFiles(filepath.Join(root, cgroupFsRoot), v2Path, v1Paths)
+	if err != nil {
+		return err
+	}
+
+	if cpuList != "" {
+		cpuSet, err := parseCPUList(cpuList)
+		if err != nil {
+			return fmt.Errorf("invalid cpuset.cpus %q: %v", cpuList, err)
+		}
+		fs.allowedCPUs = cpuSet
+	}
+	if memList != "" {
+		nodeSet, err := parseCPUList(memList)
+		if err != nil {
+			return fmt.Errorf("invalid cpuset.mems %q: %v", memList, err)
+		}
+		fs.allowedNodes = make(map[string]bool, len(nodeSet))
+		for id := range nodeSet {
+			fs.allowedNodes[strconv.Itoa(int(id))] = true
+		}
+	}
+	if memMax > 0 {
+		fs.memNodeBudgetBytes = memMax / int64(fs.allowedNodeCount())
+	}
+	return nil
+}
+
+// allowedNodeCount returns how many NUMA nodes the memory budget must be divided across:
+// the allowed set if cpuset.mems narrowed it down, otherwise every node the host has.
+func (fs *cgroupAwareSysFs) allowedNodeCount() int {
+	if len(fs.allowedNodes) > 0 {
+		return len(fs.allowedNodes)
+	}
+	if paths, err := fs.SysFs.GetNodesPaths(); err == nil && len(paths) > 0 {
+		return len(paths)
+	}
+	return 1
+}
+
+// currentCgroupPaths reads /proc/self/cgroup and returns the unified (v2) cgroup path,
+// if any, and a controller-to-path map for the v1 hierarchies it finds.
+func currentCgroupPaths(cgroupFile string) (v2Path string, v1Paths map[string]string, err error) {
+	content, err := ioutil.ReadFile(cgroupFile)
+	if err != nil {
+		return "", nil, err
+	}
+	v1Paths = make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		controllers, path := fields[1], fields[2]
+		if controllers == "" {
+			v2Path = path
+			continue
+		}
+		for _, controller := range strings.Split(controllers, ",") {
+			v1Paths[controller] = path
+		}
+	}
+	return v2Path, v1Paths, nil
+}
+
+// readCgroupFiles reads the cpuset.cpus, cpuset.mems and memory limit of the current
+// process, preferring the v2 unified hierarchy and falling back to v1 per-controller
+// mount points.
+func readCgroupFiles(cgroupRoot, v2Path string, v1Paths map[string]string) (cpuList, memList string, memMax int64, err error) {
+	if v2Path != "" {
+		cpuList = readCgroupFile(filepath.Join(cgroupRoot, v2Path, cpusetEffectiveFileV2))
+		memList = readCgroupFile(filepath.Join(cgroupRoot, v2Path, memsEffectiveFileV2))
+		if raw := readCgroupFile(filepath.Join(cgroupRoot, v2Path, memoryMaxFileV2)); raw != "" && raw != memoryUnlimitedValue {
+			memMax, _ = strconv.ParseInt(raw, 10, 64)
+		}
+	}
+	if cpuList == "" {
+		if path, ok := v1Paths["cpuset"]; ok {
+			cpuList = readCgroupFile(filepath.Join(cgroupRoot, "cpuset", path, cpusetFileV1))
+			memList = readCgroupFile(filepath.Join(cgroupRoot, "cpuset", path, memsFileV1))
+		}
+	}
+	if memMax == 0 {
+		if path, ok := v1Paths["memory"]; ok {
+			if raw := readCgroupFile(filepath.Join(cgroupRoot, "memory", path, memoryLimitFileV1)); raw != "" {
+				if v, convErr := strconv.ParseInt(raw, 10, 64); convErr == nil && v > 0 {
+					memMax = v
+				}
+			}
+		}
+	}
+	return cpuList, memList, memMax, nil
+}
+
+func readCgroupFile(path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func (fs *cgroupAwareSysFs) GetCPUsPaths(cpusPath string) ([]string, error) {
+	paths, err := fs.SysFs.GetCPUsPaths(cpusPath)
+	if err != nil || len(fs.allowedCPUs) == 0 {
+		return paths, err
+	}
+	filtered := paths[:0]
+	for _, p := range paths {
+		if id, idErr := getCPUID(p); idErr == nil && fs.allowedCPUs[id] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+func (fs *cgroupAwareSysFs) GetNodesPaths() ([]string, error) {
+	paths, err := fs.SysFs.GetNodesPaths()
+	if err != nil || len(fs.allowedNodes) == 0 {
+		return paths, err
+	}
+	filtered := paths[:0]
+	for _, p := range paths {
+		if id, idErr := getNodeID(p); idErr == nil && fs.allowedNodes[id] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+func (fs *cgroupAwareSysFs) IsCPUOnline(cpuPath string) bool {
+	if len(fs.allowedCPUs) > 0 {
+		if id, err := getCPUID(cpuPath); err == nil && !fs.allowedCPUs[id] {
+			return false
+		}
+	}
+	return fs.SysFs.IsCPUOnline(cpuPath)
+}
+
+// AllowedCPUBitmask returns the cgroup-derived cpuset as a tmutils.CPUBitmask, so hint
+// generation can be constrained to it the same way it is constrained by NUMA affinity.
+// It is the zero bitmask when no cpuset restriction was found.
+func (fs *cgroupAwareSysFs) AllowedCPUBitmask() tmutils.CPUBitmask {
+	allowed := make(map[int]bool, len(fs.allowedCPUs))
+	for id := range fs.allowedCPUs {
+		allowed[int(id)] = true
+	}
+	return tmutils.NewCPUBitmaskFromSet(allowed)
+}
+
+func (fs *cgroupAwareSysFs) GetMemInfo(nodePath string) (string, error) {
+	meminfo, err := fs.SysFs.GetMemInfo(nodePath)
+	if err != nil || fs.memNodeBudgetBytes <= 0 {
+		return meminfo, err
+	}
+	return capMemInfo(meminfo, fs.memNodeBudgetBytes), nil
+}
+
+var nodeIDRegexp = regexp.MustCompile(`node([0-9]+)`)
+
+// getNodeID extracts the NUMA node number from a node directory path such as
+// /sys/devices/system/node/node0.
+func getNodeID(dir string) (string, error) {
+	matches := nodeIDRegexp.FindStringSubmatch(dir)
+	if len(matches) != 2 {
+		return "", fmt.Errorf("can't get node ID from %s", dir)
+	}
+	return matches[1], nil
+}
+
+var (
+	memTotalRegexp = regexp.MustCompile(`(MemTotal:\s*)([0-9]+)( kB)`)
+	memFreeRegexp  = regexp.MustCompile(`(MemFree:\s*)([0-9]+)( kB)`)
+)
+
+// capMemInfo rewrites a node's meminfo content so that MemTotal never exceeds the given
+// per-node memory budget, capping MemFree to the same ceiling so the two stay consistent
+// (MemFree can never be reported larger than MemTotal).
+func capMemInfo(meminfo string, budgetBytes int64) string {
+	ceiling := budgetBytes / 1024
+	if m := memTotalRegexp.FindStringSubmatch(meminfo); m != nil {
+		if original, err := strconv.ParseInt(m[2], 10, 64); err == nil && original < ceiling {
+			ceiling = original
+		}
+	}
+	meminfo = capField(meminfo, memTotalRegexp, ceiling)
+	meminfo = capField(meminfo, memFreeRegexp, ceiling)
+	return meminfo
+}
+
+// capField replaces the numeric kB value matched by re with ceiling wherever it exceeds
+// it, leaving the rest of the line and any non-matching field untouched.
+func capField(meminfo string, re *regexp.Regexp, ceiling int64) string {
+	return re.ReplaceAllStringFunc(meminfo, func(match string) string {
+		groups := re.FindStringSubmatch(match)
+		value, err := strconv.ParseInt(groups[2], 10, 64)
+		if err != nil || value <= ceiling {
+			return match
+		}
+		return fmt.Sprintf("%s%d%s", groups[1], ceiling, groups[3])
+	})
+}
@@ -0,0 +1,165 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machineinformer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates path and its parent directories, writing content to it.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// cgroupV2Fixture lays out a fake sysfs+cgroupfs tree under root describing a process
+// confined by a cgroup v2 cpuset to CPUs 0 and 2-3, NUMA node 0 and a 2000 kB memory budget,
+// while the host itself has 4 CPUs, 2 nodes and 16336000 kB of memory per node.
+func cgroupV2Fixture(t *testing.T, root string) {
+	t.Helper()
+	writeFile(t, filepath.Join(root, procSelfCgroup), "0::/test.slice\n")
+	writeFile(t, filepath.Join(root, cgroupFsRoot, "test.slice", cpusetEffectiveFileV2), "0,2-3\n")
+	writeFile(t, filepath.Join(root, cgroupFsRoot, "test.slice", memsEffectiveFileV2), "0\n")
+	writeFile(t, filepath.Join(root, cgroupFsRoot, "test.slice", memoryMaxFileV2), "2048000\n")
+
+	for cpu := 0; cpu < 4; cpu++ {
+		writeFile(t, filepath.Join(root, "sys/devices/system/cpu", fmt.Sprintf("cpu%d", cpu), "topology/core_id"), "0\n")
+	}
+	for node := 0; node < 2; node++ {
+		writeFile(t, filepath.Join(root, "sys/devices/system/node", fmt.Sprintf("node%d", node), "meminfo"),
+			fmt.Sprintf("Node %d MemTotal:       16336000 kB\nNode %d MemFree:        8000000 kB\n", node, node))
+	}
+}
+
+func TestCgroupAwareSysFsFiltersCPUsAndNodes(t *testing.T) {
+	root := t.TempDir()
+	cgroupV2Fixture(t, root)
+	fs := NewCgroupAwareSysFs(root)
+
+	cpuPaths, err := fs.GetCPUsPaths("/sys/devices/system/cpu")
+	if err != nil {
+		t.Fatalf("GetCPUsPaths failed: %v", err)
+	}
+	gotCPUs := make(map[string]bool)
+	for _, p := range cpuPaths {
+		gotCPUs[filepath.Base(p)] = true
+	}
+	wantCPUs := map[string]bool{"cpu0": true, "cpu2": true, "cpu3": true}
+	if len(gotCPUs) != len(wantCPUs) {
+		t.Fatalf("GetCPUsPaths() = %v, want %v", gotCPUs, wantCPUs)
+	}
+	for cpu := range wantCPUs {
+		if !gotCPUs[cpu] {
+			t.Errorf("GetCPUsPaths() missing allowed %s", cpu)
+		}
+	}
+	if gotCPUs["cpu1"] {
+		t.Errorf("GetCPUsPaths() should not report cpu1, outside the cpuset")
+	}
+
+	nodePaths, err := fs.GetNodesPaths()
+	if err != nil {
+		t.Fatalf("GetNodesPaths failed: %v", err)
+	}
+	if len(nodePaths) != 1 || filepath.Base(nodePaths[0]) != "node0" {
+		t.Errorf("GetNodesPaths() = %v, want only node0", nodePaths)
+	}
+}
+
+func TestCgroupAwareSysFsIsCPUOnline(t *testing.T) {
+	root := t.TempDir()
+	cgroupV2Fixture(t, root)
+	fs := NewCgroupAwareSysFs(root)
+
+	if !fs.IsCPUOnline("/sys/devices/system/cpu/cpu0") {
+		t.Errorf("IsCPUOnline(cpu0) = false, want true: cpu0 is in the cpuset")
+	}
+	if fs.IsCPUOnline("/sys/devices/system/cpu/cpu1") {
+		t.Errorf("IsCPUOnline(cpu1) = true, want false: cpu1 is outside the cpuset")
+	}
+}
+
+func TestCgroupAwareSysFsCapsMemInfo(t *testing.T) {
+	root := t.TempDir()
+	cgroupV2Fixture(t, root)
+	fs := NewCgroupAwareSysFs(root)
+
+	meminfo, err := fs.GetMemInfo("/sys/devices/system/node/node0")
+	if err != nil {
+		t.Fatalf("GetMemInfo failed: %v", err)
+	}
+	// A single allowed node gets the whole 2000 kB budget; MemFree must be capped
+	// to the same ceiling so it never exceeds the (now smaller) MemTotal.
+	if want := "Node 0 MemTotal:       2000 kB"; !strings.Contains(meminfo, want) {
+		t.Errorf("GetMemInfo() = %q, want it to contain %q", meminfo, want)
+	}
+	if want := "MemFree:        2000 kB"; !strings.Contains(meminfo, want) {
+		t.Errorf("GetMemInfo() = %q, want it to contain %q (MemFree capped like MemTotal)", meminfo, want)
+	}
+}
+
+func TestCgroupAwareSysFsCapsMemInfoProportionally(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, procSelfCgroup), "0::/test.slice\n")
+	writeFile(t, filepath.Join(root, cgroupFsRoot, "test.slice", cpusetEffectiveFileV2), "0-3\n")
+	writeFile(t, filepath.Join(root, cgroupFsRoot, "test.slice", memsEffectiveFileV2), "0-1\n")
+	writeFile(t, filepath.Join(root, cgroupFsRoot, "test.slice", memoryMaxFileV2), "2048000\n")
+	for node := 0; node < 2; node++ {
+		writeFile(t, filepath.Join(root, "sys/devices/system/node", fmt.Sprintf("node%d", node), "meminfo"),
+			fmt.Sprintf("Node %d MemTotal:       16336000 kB\nNode %d MemFree:        8000000 kB\n", node, node))
+	}
+	fs := NewCgroupAwareSysFs(root)
+
+	// The 2000 kB budget is shared across the 2 allowed nodes: each must report at
+	// most 1000 kB, not the full budget, or summing the two nodes would overstate
+	// what the cgroup actually allows.
+	for node := 0; node < 2; node++ {
+		meminfo, err := fs.GetMemInfo(fmt.Sprintf("/sys/devices/system/node/node%d", node))
+		if err != nil {
+			t.Fatalf("GetMemInfo(node%d) failed: %v", node, err)
+		}
+		if want := fmt.Sprintf("Node %d MemTotal:       1000 kB", node); !strings.Contains(meminfo, want) {
+			t.Errorf("GetMemInfo(node%d) = %q, want it to contain %q", node, meminfo, want)
+		}
+		if want := "MemFree:        1000 kB"; !strings.Contains(meminfo, want) {
+			t.Errorf("GetMemInfo(node%d) = %q, want it to contain %q", node, meminfo, want)
+		}
+	}
+}
+
+func TestCgroupAwareSysFsNoLimitsFallsBackToHostView(t *testing.T) {
+	root := t.TempDir()
+	for cpu := 0; cpu < 2; cpu++ {
+		writeFile(t, filepath.Join(root, "sys/devices/system/cpu", fmt.Sprintf("cpu%d", cpu), "topology/core_id"), "0\n")
+	}
+	fs := NewCgroupAwareSysFs(root)
+
+	cpuPaths, err := fs.GetCPUsPaths("/sys/devices/system/cpu")
+	if err != nil {
+		t.Fatalf("GetCPUsPaths failed: %v", err)
+	}
+	if len(cpuPaths) != 2 {
+		t.Errorf("GetCPUsPaths() = %v, want both host CPUs when there is no cgroup limit", cpuPaths)
+	}
+}
@@ -49,9 +49,17 @@ const (
 	// CPUCoreID is the CPU core ID of cpu#. Typically it is the hardware platform's identifier
 	// (rather than the kernel's). The actual value is architecture and platform dependent.
 	CPUCoreID = "core_id"
+	// CPUBookID is the book id of cpu#. Books group cores above the core/package level and are
+	// only present on s390/s390x.
+	CPUBookID = "book_id"
+	// CPUDrawerID is the drawer id of cpu#. Drawers group books above the book level and are
+	// only present on s390/s390x.
+	CPUDrawerID = "drawer_id"
 
 	coreIDFilePath    = "/" + sysFsCPUTopology + "/core_id"
 	packageIDFilePath = "/" + sysFsCPUTopology + "/physical_package_id"
+	bookIDFilePath    = "/" + sysFsCPUTopology + "/book_id"
+	drawerIDFilePath  = "/" + sysFsCPUTopology + "/drawer_id"
 
 	// memory size calculations
 
@@ -108,6 +116,38 @@ func (fs *relocatableSysFs) GetCPUPhysicalPackageID(cpuPath string) (string, err
 	return strings.TrimSpace(string(packageID)), err
 }
 
+// GetBookID returns the book id of the given cpu, as found in s390/s390x topology. Books
+// group cores above the core/package level and are absent on every other architecture, so
+// a missing book_id file is not an error: it just means there is nothing to report.
+// See Core and GetCores below for the per-CPU struct that threads this value through
+// alongside the rest of a CPU's topology.
+func (fs *relocatableSysFs) GetBookID(cpuPath string) (string, error) {
+	bookIDFilePath := filepath.Join(fs.root, cpuPath, bookIDFilePath)
+	bookID, err := ioutil.ReadFile(bookIDFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(bookID)), nil
+}
+
+// GetDrawerID returns the drawer id of the given cpu, as found in s390/s390x topology.
+// Drawers group books above the book level and are absent on every other architecture, so
+// a missing drawer_id file is not an error: it just means there is nothing to report.
+func (fs *relocatableSysFs) GetDrawerID(cpuPath string) (string, error) {
+	drawerIDFilePath := filepath.Join(fs.root, cpuPath, drawerIDFilePath)
+	drawerID, err := ioutil.ReadFile(drawerIDFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(drawerID)), nil
+}
+
 func (fs *relocatableSysFs) GetMemInfo(nodePath string) (string, error) {
 	meminfoPath := filepath.Join(fs.root, nodePath, meminfoFile)
 	meminfo, err := ioutil.ReadFile(meminfoPath)
@@ -290,6 +330,119 @@ func (fs *relocatableSysFs) GetCacheInfo(id int, name string) (sysfs.CacheInfo,
 	}, nil
 }
 
+// coreThreadCount returns how many CPU threads share the innermost (index0) cache of the
+// given cpu, i.e. how many hardware threads live on a single core. It is the baseline
+// used to tell a per-core cache apart from an uncore one that spans a whole socket or CCX.
+func (fs *relocatableSysFs) coreThreadCount(id int) (int, error) {
+	index0Path := filepath.Join(fs.root, fmt.Sprintf("%s%d/cache/index0", cacheDir, id))
+	return getCPUCount(index0Path)
+}
+
+// GetUncoreCaches returns the directory information for the uncore caches accessible to
+// the given cpu: caches whose shared_cpu_map spans more threads than fit on a single core,
+// such as a socket-wide or CCX-wide last-level cache. See Core and GetCores below for the
+// per-CPU struct that threads this value through as an UncoreCaches field.
+func (fs *relocatableSysFs) GetUncoreCaches(id int) ([]os.FileInfo, error) {
+	caches, err := fs.GetCaches(id)
+	if err != nil {
+		return nil, err
+	}
+	threadsPerCore, err := fs.coreThreadCount(id)
+	if err != nil {
+		return nil, err
+	}
+	var uncoreCaches []os.FileInfo
+	for _, cache := range caches {
+		cachePath := filepath.Join(fs.root, fmt.Sprintf("%s%d/cache", cacheDir, id), cache.Name())
+		cpuCount, err := getCPUCount(cachePath)
+		if err != nil {
+			return nil, err
+		}
+		if cpuCount > threadsPerCore {
+			uncoreCaches = append(uncoreCaches, cache)
+		}
+	}
+	return uncoreCaches, nil
+}
+
+// GetUncoreCacheInfo returns information for an uncore cache accessible from the given
+// cpu, failing if the named cache is actually scoped to a single core.
+func (fs *relocatableSysFs) GetUncoreCacheInfo(id int, name string) (sysfs.CacheInfo, error) {
+	threadsPerCore, err := fs.coreThreadCount(id)
+	if err != nil {
+		return sysfs.CacheInfo{}, err
+	}
+	cachePath := filepath.Join(fs.root, fmt.Sprintf("%s%d/cache/%s", cacheDir, id, name))
+	cpuCount, err := getCPUCount(cachePath)
+	if err != nil {
+		return sysfs.CacheInfo{}, err
+	}
+	if cpuCount <= threadsPerCore {
+		return sysfs.CacheInfo{}, fmt.Errorf("cache %s of cpu%d is not an uncore cache", name, id)
+	}
+	return fs.GetCacheInfo(id, name)
+}
+
+// Core aggregates everything relocatableSysFs can discover about a single CPU - its
+// physical package, core, s390/s390x book/drawer (empty string where not applicable) and
+// the uncore caches it shares with other CPUs - into the one per-CPU struct the requests
+// that added BookID/DrawerID and UncoreCaches asked these values to be threaded through,
+// rather than requiring callers to call each Get* accessor separately for every CPU.
+type Core struct {
+	ID           int
+	PackageID    string
+	CoreID       string
+	BookID       string
+	DrawerID     string
+	UncoreCaches []sysfs.CacheInfo
+}
+
+// GetCores walks every CPU found under cpusPath and returns one Core per CPU, aggregating
+// its topology and uncore cache info.
+func (fs *relocatableSysFs) GetCores(cpusPath string) ([]Core, error) {
+	paths, err := fs.GetCPUsPaths(cpusPath)
+	if err != nil {
+		return nil, err
+	}
+	cores := make([]Core, 0, len(paths))
+	for _, p := range paths {
+		cpuID, err := getCPUID(p)
+		if err != nil {
+			return nil, err
+		}
+		// The Get*ID accessors join fs.root themselves, but GetCPUsPaths already
+		// returned fs.root-joined paths; rebuild the root-relative one they expect.
+		cpuPath := filepath.Join(cpusPath, fmt.Sprintf("cpu%d", cpuID))
+
+		core := Core{ID: int(cpuID)}
+		if core.PackageID, err = fs.GetCPUPhysicalPackageID(cpuPath); err != nil {
+			return nil, err
+		}
+		if core.CoreID, err = fs.GetCoreID(cpuPath); err != nil {
+			return nil, err
+		}
+		if core.BookID, err = fs.GetBookID(cpuPath); err != nil {
+			return nil, err
+		}
+		if core.DrawerID, err = fs.GetDrawerID(cpuPath); err != nil {
+			return nil, err
+		}
+		uncoreCaches, err := fs.GetUncoreCaches(int(cpuID))
+		if err != nil {
+			return nil, err
+		}
+		for _, cache := range uncoreCaches {
+			info, err := fs.GetUncoreCacheInfo(int(cpuID), cache.Name())
+			if err != nil {
+				return nil, err
+			}
+			core.UncoreCaches = append(core.UncoreCaches, info)
+		}
+		cores = append(cores, core)
+	}
+	return cores, nil
+}
+
 func (fs *relocatableSysFs) GetSystemUUID() (string, error) {
 	if id, err := ioutil.ReadFile(filepath.Join(fs.root, dmiDir, "id", "product_uuid")); err == nil {
 		return strings.TrimSpace(string(id)), nil
@@ -360,45 +513,55 @@ func isCPUOnline(path string, cpuID uint16) (bool, error) {
 		return false, fmt.Errorf("%s found to be empty", path)
 	}
 
-	cpuList := strings.TrimSpace(string(fileContent))
+	cpuSet, err := parseCPUList(strings.TrimSpace(string(fileContent)))
+	if err != nil {
+		return false, fmt.Errorf("invalid values in %s: %v", path, err)
+	}
+	return cpuSet[cpuID], nil
+}
+
+// parseCPUList parses a kernel CPU list (such as: 0,3-5,10) into the set of CPU ids it
+// contains. It backs both isCPUOnline and the cgroup-aware sysfs, which needs the same
+// range syntax to parse cpuset.cpus.
+func parseCPUList(cpuList string) (map[uint16]bool, error) {
+	cpuSet := make(map[uint16]bool)
+	if cpuList == "" {
+		return cpuSet, nil
+	}
 	for _, s := range strings.Split(cpuList, ",") {
 		splitted := strings.SplitN(s, "-", 3)
 		switch len(splitted) {
 		case 3:
-			return false, fmt.Errorf("invalid values in %s", path)
+			return nil, fmt.Errorf("invalid values in %q", cpuList)
 		case 2:
 			min, err := strconv.ParseUint(splitted[0], 10, 16)
 			if err != nil {
-				return false, err
+				return nil, err
 			}
 			max, err := strconv.ParseUint(splitted[1], 10, 16)
 			if err != nil {
-				return false, err
+				return nil, err
 			}
 			if min > max {
-				return false, fmt.Errorf("invalid values in %s", path)
+				return nil, fmt.Errorf("invalid values in %q", cpuList)
 			}
 			for i := min; i <= max; i++ {
-				if uint16(i) == cpuID {
-					return true, nil
-				}
+				cpuSet[uint16(i)] = true
 			}
 		case 1:
 			value, err := strconv.ParseUint(s, 10, 16)
 			if err != nil {
-				return false, err
-			}
-			if uint16(value) == cpuID {
-				return true, nil
+				return nil, err
 			}
+			cpuSet[uint16(value)] = true
 		}
 	}
-
-	return false, nil
+	return cpuSet, nil
 }
 
-// Looks for sysfs cpu path containing given CPU property, e.g. core_id or physical_package_id
-// and returns number of unique values of given property, exemplary usage: getting number of CPU physical cores
+// Looks for sysfs cpu path containing given CPU property, e.g. core_id, book_id or drawer_id,
+// and returns number of unique (property, physical_package_id) pairs, exemplary usage: getting
+// the number of CPU physical cores, or, on s390/s390x, the number of books or drawers
 func GetUniqueCPUPropertyCount(cpuBusPath string, propertyName string) int {
 	absCPUBusPath, err := filepath.Abs(cpuBusPath)
 	if err != nil {
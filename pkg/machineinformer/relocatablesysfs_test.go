@@ -0,0 +1,174 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machineinformer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// s390xCPU describes one leaf of a synthetic s390x topology: a drawer containing a book
+// containing a physical package, each cpu sitting alone in its own core.
+type s390xCPU struct {
+	cpuID     int
+	coreID    int
+	packageID int
+	bookID    int
+	drawerID  int
+}
+
+// writeS390xTopology lays out a fake sysfs tree rooted at root, modeling multiple drawers
+// each containing multiple books, each containing multiple sockets, as seen on s390/s390x.
+func writeS390xTopology(t *testing.T, root string, cpus []s390xCPU) {
+	t.Helper()
+	for _, cpu := range cpus {
+		topoDir := filepath.Join(root, "sys/devices/system/cpu", fmt.Sprintf("cpu%d", cpu.cpuID), "topology")
+		if err := os.MkdirAll(topoDir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", topoDir, err)
+		}
+		files := map[string]int{
+			"core_id":             cpu.coreID,
+			"physical_package_id": cpu.packageID,
+			"book_id":             cpu.bookID,
+			"drawer_id":           cpu.drawerID,
+		}
+		for name, val := range files {
+			path := filepath.Join(topoDir, name)
+			if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n", val)), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", path, err)
+			}
+		}
+	}
+}
+
+// s390xFixture returns 2 drawers, 2 books per drawer, 2 packages per book and 2 cores per
+// package: multiple drawers containing books containing sockets, as seen on s390/s390x.
+func s390xFixture() []s390xCPU {
+	var cpus []s390xCPU
+	cpuID := 0
+	for drawer := 0; drawer < 2; drawer++ {
+		for book := 0; book < 2; book++ {
+			bookID := drawer*2 + book
+			for pkg := 0; pkg < 2; pkg++ {
+				packageID := bookID*2 + pkg
+				for core := 0; core < 2; core++ {
+					cpus = append(cpus, s390xCPU{
+						cpuID:     cpuID,
+						coreID:    core,
+						packageID: packageID,
+						bookID:    bookID,
+						drawerID:  drawer,
+					})
+					cpuID++
+				}
+			}
+		}
+	}
+	return cpus
+}
+
+func TestGetBookAndDrawerID(t *testing.T) {
+	root := t.TempDir()
+	writeS390xTopology(t, root, s390xFixture())
+	fs := NewRelocatableSysFs(root)
+
+	bookID, err := fs.(*relocatableSysFs).GetBookID("/sys/devices/system/cpu/cpu5")
+	if err != nil {
+		t.Fatalf("GetBookID failed: %v", err)
+	}
+	if bookID != "1" {
+		t.Errorf("GetBookID() = %q, want %q", bookID, "1")
+	}
+
+	drawerID, err := fs.(*relocatableSysFs).GetDrawerID("/sys/devices/system/cpu/cpu5")
+	if err != nil {
+		t.Fatalf("GetDrawerID failed: %v", err)
+	}
+	if drawerID != "0" {
+		t.Errorf("GetDrawerID() = %q, want %q", drawerID, "0")
+	}
+}
+
+func TestGetBookAndDrawerIDMissingIsNoop(t *testing.T) {
+	root := t.TempDir()
+	topoDir := filepath.Join(root, "sys/devices/system/cpu/cpu0/topology")
+	if err := os.MkdirAll(topoDir, 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", topoDir, err)
+	}
+	fs := NewRelocatableSysFs(root).(*relocatableSysFs)
+
+	if bookID, err := fs.GetBookID("/sys/devices/system/cpu/cpu0"); err != nil || bookID != "" {
+		t.Errorf("GetBookID() = (%q, %v), want (\"\", nil) when book_id is absent", bookID, err)
+	}
+	if drawerID, err := fs.GetDrawerID("/sys/devices/system/cpu/cpu0"); err != nil || drawerID != "" {
+		t.Errorf("GetDrawerID() = (%q, %v), want (\"\", nil) when drawer_id is absent", drawerID, err)
+	}
+}
+
+func TestGetCoresAggregatesTopologyAndUncoreCaches(t *testing.T) {
+	root := t.TempDir()
+	// 2 cpus, same package, each its own core, sharing one socket-wide L3.
+	for cpu := 0; cpu < 2; cpu++ {
+		writeFile(t, filepath.Join(root, "sys/devices/system/cpu", fmt.Sprintf("cpu%d", cpu), "topology/core_id"), fmt.Sprintf("%d\n", cpu))
+		writeFile(t, filepath.Join(root, "sys/devices/system/cpu", fmt.Sprintf("cpu%d", cpu), "topology/physical_package_id"), "0\n")
+		writeCache(t, root, cpu, cacheFixture{index: "index0", level: 1, cacheType: "Data", sizeKB: 32, sharedCPUMap: fmt.Sprintf("%08x", 1<<uint(cpu))})
+		writeCache(t, root, cpu, cacheFixture{index: "index3", level: 3, cacheType: "Unified", sizeKB: 8192, sharedCPUMap: "00000003"})
+	}
+	fs := NewRelocatableSysFs(root).(*relocatableSysFs)
+
+	cores, err := fs.GetCores("/sys/devices/system/cpu")
+	if err != nil {
+		t.Fatalf("GetCores failed: %v", err)
+	}
+	if len(cores) != 2 {
+		t.Fatalf("got %d cores, want 2", len(cores))
+	}
+	sort.Slice(cores, func(i, j int) bool { return cores[i].ID < cores[j].ID })
+
+	if cores[0].ID != 0 || cores[0].PackageID != "0" || cores[0].CoreID != "0" {
+		t.Errorf("cores[0] = %+v, want ID=0 PackageID=\"0\" CoreID=\"0\"", cores[0])
+	}
+	if cores[0].BookID != "" || cores[0].DrawerID != "" {
+		t.Errorf("cores[0] = %+v, want empty BookID/DrawerID on a non-s390x fixture", cores[0])
+	}
+	if len(cores[0].UncoreCaches) != 1 || cores[0].UncoreCaches[0].Cpus != 2 || cores[0].UncoreCaches[0].Level != 3 {
+		t.Errorf("cores[0].UncoreCaches = %+v, want one level-3 cache shared by 2 cpus", cores[0].UncoreCaches)
+	}
+}
+
+func TestGetUniqueCPUPropertyCountBooksAndDrawers(t *testing.T) {
+	root := t.TempDir()
+	writeS390xTopology(t, root, s390xFixture())
+	cpuBusPath := filepath.Join(root, "sys/devices/system/cpu")
+
+	// book_id and drawer_id are coarser than physical_package_id, so every package
+	// contributes exactly one (book, package) and (drawer, package) pair: the count
+	// equals the number of distinct packages (8), same as for any other property at
+	// least as coarse as the package itself.
+	if got := GetUniqueCPUPropertyCount(cpuBusPath, CPUBookID); got != 8 {
+		t.Errorf("GetUniqueCPUPropertyCount(%s) = %d, want 8", CPUBookID, got)
+	}
+	if got := GetUniqueCPUPropertyCount(cpuBusPath, CPUDrawerID); got != 8 {
+		t.Errorf("GetUniqueCPUPropertyCount(%s) = %d, want 8", CPUDrawerID, got)
+	}
+	// core_id is finer than physical_package_id (2 cores per package here), so the
+	// count reflects the actual number of physical cores across all packages.
+	if got := GetUniqueCPUPropertyCount(cpuBusPath, CPUCoreID); got != 16 {
+		t.Errorf("GetUniqueCPUPropertyCount(%s) = %d, want 16 (core_id, package) pairs", CPUCoreID, got)
+	}
+}
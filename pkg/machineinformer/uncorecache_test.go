@@ -0,0 +1,118 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package machineinformer
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+type cacheFixture struct {
+	index        string
+	level        int
+	cacheType    string
+	sizeKB       int
+	sharedCPUMap string // hex shared_cpu_map, bit count is all that matters here
+}
+
+func writeCache(t *testing.T, root string, cpu int, c cacheFixture) {
+	t.Helper()
+	dir := filepath.Join(root, fmt.Sprintf("sys/devices/system/cpu/cpu%d/cache/%s", cpu, c.index))
+	writeFile(t, filepath.Join(dir, "size"), fmt.Sprintf("%dK\n", c.sizeKB))
+	writeFile(t, filepath.Join(dir, "level"), fmt.Sprintf("%d\n", c.level))
+	writeFile(t, filepath.Join(dir, "type"), c.cacheType+"\n")
+	writeFile(t, filepath.Join(dir, "shared_cpu_map"), c.sharedCPUMap+"\n")
+}
+
+// twoSocketFixture models a 2-socket box, 4 cores per socket, 2 SMT threads per core: per-core
+// L1/L2 shared by the 2 sibling threads, and one package-wide L3 shared by all 8 cpus of a socket.
+func twoSocketFixture(t *testing.T, root string) {
+	t.Helper()
+	for socket := 0; socket < 2; socket++ {
+		for core := 0; core < 4; core++ {
+			for thread := 0; thread < 2; thread++ {
+				cpu := socket*8 + core*2 + thread
+				writeCache(t, root, cpu, cacheFixture{index: "index0", level: 1, cacheType: "Data", sizeKB: 32, sharedCPUMap: "00000003"})
+				writeCache(t, root, cpu, cacheFixture{index: "index1", level: 1, cacheType: "Instruction", sizeKB: 32, sharedCPUMap: "00000003"})
+				writeCache(t, root, cpu, cacheFixture{index: "index2", level: 2, cacheType: "Unified", sizeKB: 256, sharedCPUMap: "00000003"})
+				writeCache(t, root, cpu, cacheFixture{index: "index3", level: 3, cacheType: "Unified", sizeKB: 16384, sharedCPUMap: "000000ff"})
+			}
+		}
+	}
+}
+
+// zenCCXFixture models a Zen-style part with 4 CCXes, 4 single-threaded cores each: per-core
+// L1/L2 not shared with any other cpu, and one L3 shared by the 4 cpus of each CCX.
+func zenCCXFixture(t *testing.T, root string) {
+	t.Helper()
+	for ccx := 0; ccx < 4; ccx++ {
+		for core := 0; core < 4; core++ {
+			cpu := ccx*4 + core
+			writeCache(t, root, cpu, cacheFixture{index: "index0", level: 1, cacheType: "Data", sizeKB: 32, sharedCPUMap: "00000001"})
+			writeCache(t, root, cpu, cacheFixture{index: "index1", level: 1, cacheType: "Instruction", sizeKB: 64, sharedCPUMap: "00000001"})
+			writeCache(t, root, cpu, cacheFixture{index: "index2", level: 2, cacheType: "Unified", sizeKB: 512, sharedCPUMap: "00000001"})
+			writeCache(t, root, cpu, cacheFixture{index: "index3", level: 3, cacheType: "Unified", sizeKB: 16384, sharedCPUMap: fmt.Sprintf("%08x", 0xf<<uint(ccx*4))})
+		}
+	}
+}
+
+func TestGetUncoreCachesTwoSocket(t *testing.T) {
+	root := t.TempDir()
+	twoSocketFixture(t, root)
+	fs := NewRelocatableSysFs(root)
+
+	uncore, err := fs.(*relocatableSysFs).GetUncoreCaches(0)
+	if err != nil {
+		t.Fatalf("GetUncoreCaches failed: %v", err)
+	}
+	if len(uncore) != 1 || uncore[0].Name() != "index3" {
+		t.Fatalf("GetUncoreCaches(cpu0) = %v, want only index3 (the socket-wide L3)", uncore)
+	}
+
+	info, err := fs.(*relocatableSysFs).GetUncoreCacheInfo(0, "index3")
+	if err != nil {
+		t.Fatalf("GetUncoreCacheInfo failed: %v", err)
+	}
+	if info.Cpus != 8 || info.Level != 3 {
+		t.Errorf("GetUncoreCacheInfo(index3) = %+v, want 8 cpus at level 3", info)
+	}
+
+	if _, err := fs.(*relocatableSysFs).GetUncoreCacheInfo(0, "index2"); err == nil {
+		t.Errorf("GetUncoreCacheInfo(index2) succeeded, want an error: the L2 is per-core, not uncore")
+	}
+}
+
+func TestGetUncoreCachesZenCCX(t *testing.T) {
+	root := t.TempDir()
+	zenCCXFixture(t, root)
+	fs := NewRelocatableSysFs(root)
+
+	uncore, err := fs.(*relocatableSysFs).GetUncoreCaches(5) // cpu5 sits in CCX 1
+	if err != nil {
+		t.Fatalf("GetUncoreCaches failed: %v", err)
+	}
+	if len(uncore) != 1 || uncore[0].Name() != "index3" {
+		t.Fatalf("GetUncoreCaches(cpu5) = %v, want only index3 (the CCX-wide L3)", uncore)
+	}
+
+	info, err := fs.(*relocatableSysFs).GetUncoreCacheInfo(5, "index3")
+	if err != nil {
+		t.Fatalf("GetUncoreCacheInfo failed: %v", err)
+	}
+	if info.Cpus != 4 {
+		t.Errorf("GetUncoreCacheInfo(index3) = %+v, want 4 cpus (one CCX)", info)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmutils
+
+// CPUBitmask is a bitmask over CPU ids, one bit per CPU, sized to the highest CPU id it
+// was built with rather than a fixed word size. It lets hint generation be constrained to
+// a cgroup-imposed cpuset the same way a NUMA affinity Mask constrains it to a set of
+// nodes, without silently losing CPUs on hosts with 64 or more logical CPUs.
+type CPUBitmask []bool
+
+// NewCPUBitmaskFromSet builds a CPUBitmask from a discovered set of allowed CPU ids,
+// such as the one a cgroup-aware sysfs derives from cpuset.cpus.effective. The mask is
+// sized to cover the highest CPU id present in allowedCPUs.
+func NewCPUBitmaskFromSet(allowedCPUs map[int]bool) CPUBitmask {
+	maxCPU := -1
+	for cpu, allowed := range allowedCPUs {
+		if allowed && cpu > maxCPU {
+			maxCPU = cpu
+		}
+	}
+	mask := make(CPUBitmask, maxCPU+1)
+	for cpu, allowed := range allowedCPUs {
+		if allowed && cpu >= 0 {
+			mask[cpu] = true
+		}
+	}
+	return mask
+}
+
+// IsSet reports whether the given CPU id is allowed by the bitmask.
+func (m CPUBitmask) IsSet(cpu int) bool {
+	if cpu < 0 || cpu >= len(m) {
+		return false
+	}
+	return m[cpu]
+}
+
+// String renders the bitmask as a binary string, most significant bit (the highest CPU
+// id) first.
+func (m CPUBitmask) String() string {
+	if len(m) == 0 {
+		return "0"
+	}
+	bits := make([]byte, len(m))
+	for cpu, set := range m {
+		if set {
+			bits[len(m)-1-cpu] = '1'
+		} else {
+			bits[len(m)-1-cpu] = '0'
+		}
+	}
+	return string(bits)
+}
@@ -0,0 +1,56 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmutils
+
+import "testing"
+
+func TestNewCPUBitmaskFromSet(t *testing.T) {
+	mask := NewCPUBitmaskFromSet(map[int]bool{0: true, 3: true, 5: true})
+
+	for cpu := 0; cpu < 8; cpu++ {
+		want := cpu == 0 || cpu == 3 || cpu == 5
+		if got := mask.IsSet(cpu); got != want {
+			t.Errorf("mask.IsSet(%d) = %v, want %v", cpu, got, want)
+		}
+	}
+}
+
+func TestCPUBitmaskIsSetOutOfRange(t *testing.T) {
+	mask := NewCPUBitmaskFromSet(map[int]bool{0: true})
+	if mask.IsSet(-1) {
+		t.Errorf("mask.IsSet(-1) = true, want false")
+	}
+	if mask.IsSet(64) {
+		t.Errorf("mask.IsSet(64) = true, want false")
+	}
+}
+
+func TestCPUBitmaskBeyond64CPUs(t *testing.T) {
+	// Multi-socket/SMT hosts routinely expose 64+ logical CPUs; a fixed uint64 mask
+	// would silently drop these. The mask must grow to fit them instead.
+	mask := NewCPUBitmaskFromSet(map[int]bool{0: true, 130: true})
+
+	if !mask.IsSet(130) {
+		t.Errorf("mask.IsSet(130) = false, want true: CPU ids beyond 64 must not be dropped")
+	}
+	if mask.IsSet(129) {
+		t.Errorf("mask.IsSet(129) = true, want false")
+	}
+	if !mask.IsSet(0) {
+		t.Errorf("mask.IsSet(0) = false, want true")
+	}
+}
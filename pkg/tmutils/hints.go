@@ -0,0 +1,166 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TopologyHint is a single affinity hint: M is the affinity mask (a NUMA node mask in the
+// parsed hint formats, a CPU mask in the hints GenerateLLCAffinityHints builds) and P
+// reports whether that affinity is preferred.
+type TopologyHint struct {
+	Mask      string `json:"M"`
+	Preferred bool   `json:"P"`
+}
+
+// Hint is the set of TopologyHints generated for one resource, e.g. "cpu" or
+// "nvidia.com/gpu".
+type Hint struct {
+	Resource string         `json:"R"`
+	Hints    []TopologyHint `json:"H"`
+}
+
+var (
+	goHintLineRe  = regexp.MustCompile(`^([^:]+):\[(.*)\]$`)
+	goHintEntryRe = regexp.MustCompile(`\{(\S+) (true|false)\}`)
+)
+
+// ParseJSONHints parses a slice of JSON-encoded hint lines, one Hint per line, in the
+// `{"R":"<resource>", "H":[{"M":"<mask>","P":<bool>}, ...]}` form.
+func ParseJSONHints(raw []string) ([]Hint, error) {
+	hints := make([]Hint, 0, len(raw))
+	for _, line := range raw {
+		hint, err := parseJSONHint(line)
+		if err != nil {
+			return nil, err
+		}
+		hints = append(hints, hint)
+	}
+	return hints, nil
+}
+
+func parseJSONHint(line string) (Hint, error) {
+	var hint Hint
+	if err := json.Unmarshal([]byte(line), &hint); err != nil {
+		return Hint{}, fmt.Errorf("malformed JSON hint %q: %v", line, err)
+	}
+	return hint, nil
+}
+
+// ParseGOHints parses a slice of hint lines in the Go fmt.Sprintf("%s:%v", ...) form
+// produced by printing a resource name and its []TopologyHint, e.g.
+// "cpu:[{01 true} {10 true} {11 false}]".
+func ParseGOHints(raw []string) ([]Hint, error) {
+	hints := make([]Hint, 0, len(raw))
+	for _, line := range raw {
+		hint, err := parseGOHint(line)
+		if err != nil {
+			return nil, err
+		}
+		hints = append(hints, hint)
+	}
+	return hints, nil
+}
+
+func parseGOHint(line string) (Hint, error) {
+	matches := goHintLineRe.FindStringSubmatch(line)
+	if matches == nil {
+		return Hint{}, fmt.Errorf("malformed GO hint %q", line)
+	}
+	var topologyHints []TopologyHint
+	for _, entry := range goHintEntryRe.FindAllStringSubmatch(matches[2], -1) {
+		preferred, err := strconv.ParseBool(entry[2])
+		if err != nil {
+			return Hint{}, fmt.Errorf("malformed GO hint entry %q in %q: %v", entry[0], line, err)
+		}
+		topologyHints = append(topologyHints, TopologyHint{Mask: entry[1], Preferred: preferred})
+	}
+	return Hint{Resource: matches[1], Hints: topologyHints}, nil
+}
+
+// ParseHintsAuto sniffs the first non-whitespace byte of raw to tell the JSON and GO hint
+// formats apart, so callers no longer need to pick the parser themselves.
+func ParseHintsAuto(raw []string) ([]Hint, error) {
+	for _, line := range raw {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if trimmed[0] == '{' {
+			return ParseJSONHints(raw)
+		}
+		return ParseGOHints(raw)
+	}
+	return nil, nil
+}
+
+// ParseJSONHintsReader streams newline-delimited JSON hints from r, one Hint per line in
+// the same schema as ParseJSONHints, without requiring the whole input to be buffered
+// up front. Parsed hints are sent on the returned channel as they arrive; a malformed
+// line does not stop the scan of the rest of r. The hints channel is closed once r is
+// exhausted. Parse errors are accumulated internally, rather than sent as they occur, so
+// that a caller draining only the hints channel (the common `for hint := range hints`
+// pattern) can never deadlock the producer; the errors channel then receives at most one
+// aggregated error before it, too, is closed.
+func ParseJSONHintsReader(r io.Reader) (<-chan Hint, <-chan error) {
+	hints := make(chan Hint)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(hints)
+		defer close(errs)
+		var parseErrs []string
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			hint, err := parseJSONHint(line)
+			if err != nil {
+				parseErrs = append(parseErrs, err.Error())
+				continue
+			}
+			hints <- hint
+		}
+		if err := scanner.Err(); err != nil {
+			parseErrs = append(parseErrs, err.Error())
+		}
+		if len(parseErrs) > 0 {
+			errs <- fmt.Errorf("%d hint line(s) failed to parse: %s", len(parseErrs), strings.Join(parseErrs, "; "))
+		}
+	}()
+	return hints, errs
+}
+
+// WriteJSONHints emits hints as newline-delimited JSON, in the same schema ParseJSONHints
+// and ParseJSONHintsReader consume.
+func WriteJSONHints(w io.Writer, hints []Hint) error {
+	enc := json.NewEncoder(w)
+	for _, hint := range hints {
+		if err := enc.Encode(hint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -17,7 +17,10 @@
 package tmutils
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -49,3 +52,131 @@ func TestParseHints(t *testing.T) {
 		t.Errorf("parsed hints are different: json=%#v go=%#v", jsonHints, goHints)
 	}
 }
+
+func TestParseHintsAuto(t *testing.T) {
+	fromJSON, err := ParseHintsAuto(rawJSONHints)
+	if err != nil {
+		t.Fatalf("ParseHintsAuto(JSON) failed: %v", err)
+	}
+	fromGO, err := ParseHintsAuto(rawGOHints)
+	if err != nil {
+		t.Fatalf("ParseHintsAuto(GO) failed: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromGO) {
+		t.Errorf("parsed hints are different: json=%#v go=%#v", fromJSON, fromGO)
+	}
+}
+
+func TestParseJSONHintsReaderNDJSON(t *testing.T) {
+	r := strings.NewReader(strings.Join(rawJSONHints, "\n") + "\n")
+	hints, errs := ParseJSONHintsReader(r)
+
+	var got []Hint
+	for hint := range hints {
+		got = append(got, hint)
+	}
+	for err := range errs {
+		t.Errorf("unexpected error from well-formed NDJSON: %v", err)
+	}
+
+	want, err := ParseJSONHints(rawJSONHints)
+	if err != nil {
+		t.Fatalf("ParseJSONHints failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed hints = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseJSONHintsReaderMalformedLine(t *testing.T) {
+	lines := []string{
+		rawJSONHints[0],
+		`{"R": this is not JSON`,
+		rawJSONHints[1],
+	}
+	r := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	hints, errs := ParseJSONHintsReader(r)
+
+	// The natural `for hint := range hints` consumer must never deadlock, even though
+	// one line fails to parse: the producer must not block trying to send on errs while
+	// nobody is draining it yet.
+	var got []Hint
+	for hint := range hints {
+		got = append(got, hint)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d hints, want 2: the malformed line must not swallow the surrounding ones", len(got))
+	}
+
+	err, ok := <-errs
+	if !ok {
+		t.Fatalf("got no error, want one reporting the malformed line")
+	}
+	if !strings.Contains(err.Error(), "1 hint line(s) failed to parse") {
+		t.Errorf("error = %v, want it to report exactly 1 failed line", err)
+	}
+	if _, ok := <-errs; ok {
+		t.Errorf("errs produced a second value, want exactly one aggregated error then close")
+	}
+}
+
+func TestWriteJSONHintsRoundTrip(t *testing.T) {
+	want, err := ParseJSONHints(rawJSONHints)
+	if err != nil {
+		t.Fatalf("ParseJSONHints failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSONHints(&buf, want); err != nil {
+		t.Fatalf("WriteJSONHints failed: %v", err)
+	}
+
+	hints, errs := ParseJSONHintsReader(&buf)
+	var got []Hint
+	for hint := range hints {
+		got = append(got, hint)
+	}
+	for err := range errs {
+		t.Errorf("unexpected error reading back written hints: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round-tripped hints = %#v, want %#v", got, want)
+	}
+}
+
+func benchmarkHints(n int) []string {
+	raw := make([]string, n)
+	for i := range raw {
+		raw[i] = fmt.Sprintf(`{"R":"bench%d", "H":[{"M":"01","P":true},{"M":"10","P":false}]}`, i)
+	}
+	return raw
+}
+
+func BenchmarkParseJSONHintsBatch(b *testing.B) {
+	raw := benchmarkHints(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseJSONHints(raw); err != nil {
+			b.Fatalf("ParseJSONHints failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkParseJSONHintsReaderStreaming(b *testing.B) {
+	raw := benchmarkHints(10000)
+	input := strings.Join(raw, "\n") + "\n"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hints, errs := ParseJSONHintsReader(strings.NewReader(input))
+		count := 0
+		for range hints {
+			count++
+		}
+		if err, ok := <-errs; ok {
+			b.Fatalf("unexpected error: %v", err)
+		}
+		if count != len(raw) {
+			b.Fatalf("got %d hints, want %d", count, len(raw))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmutils
+
+import "sort"
+
+// LLCTopology maps a CPU id to an opaque identifier for the last-level (uncore) cache it
+// is co-resident on. CPUs that map to the same identifier share that cache, so the
+// identifier must tell cache instances apart: a sysfs index name such as "index3" does
+// not, since every CPU of every socket uses it. tmutils cannot depend on machineinformer
+// (machineinformer already depends on tmutils), so callers build this map themselves; the
+// UncoreCaches field of machineinformer's Core struct carries each cache's size, level,
+// type and sharing count, but not which CPUs share it.
+type LLCTopology map[int]string
+
+// GenerateLLCAffinityHints builds one TopologyHint per way of grouping whole LLCs together
+// that together hold at least count CPUs - the same "which nodes must this request span"
+// shape ParseJSONHints' existing NUMA-node examples use, generalized from NUMA nodes to LLC
+// groups. This is bounded by the number of distinct LLCs on the host (sockets/CCXes, a
+// handful at most), never by the number of CPUs: enumerating subsets of individual CPUs
+// instead would be combinatorially infeasible (C(64,8) is already ~4.4 billion).
+//
+// A hint's Mask covers every CPU in the LLCs it spans, and it is Preferred exactly when a
+// single LLC alone holds enough CPUs to satisfy count: that is the only case where the
+// request can stay within one cache.
+func GenerateLLCAffinityHints(resource string, topology LLCTopology, count int) Hint {
+	groups := groupByLLC(topology)
+	llcIDs := make([]string, 0, len(groups))
+	for id := range groups {
+		llcIDs = append(llcIDs, id)
+	}
+	sort.Strings(llcIDs)
+
+	var hints []TopologyHint
+	for size := 1; size <= len(llcIDs); size++ {
+		forEachCombination(len(llcIDs), size, func(indices []int) {
+			cpus := make(map[int]bool)
+			for _, idx := range indices {
+				for _, cpu := range groups[llcIDs[idx]] {
+					cpus[cpu] = true
+				}
+			}
+			if len(cpus) < count {
+				return
+			}
+			hints = append(hints, TopologyHint{
+				Mask:      NewCPUBitmaskFromSet(cpus).String(),
+				Preferred: size == 1,
+			})
+		})
+	}
+	return Hint{Resource: resource, Hints: hints}
+}
+
+// groupByLLC inverts topology into, for each LLC identifier, the sorted CPUs that share it.
+func groupByLLC(topology LLCTopology) map[string][]int {
+	groups := make(map[string][]int)
+	for cpu, llc := range topology {
+		groups[llc] = append(groups[llc], cpu)
+	}
+	for _, cpus := range groups {
+		sort.Ints(cpus)
+	}
+	return groups
+}
+
+// forEachCombination calls fn once for every k-sized combination of the indices [0,n), in
+// lexicographic order.
+func forEachCombination(n, k int, fn func([]int)) {
+	if k <= 0 || k > n {
+		return
+	}
+	indices := make([]int, k)
+	for i := range indices {
+		indices[i] = i
+	}
+	for {
+		combo := make([]int, k)
+		copy(combo, indices)
+		fn(combo)
+
+		i := k - 1
+		for i >= 0 && indices[i] == i+n-k {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		indices[i]++
+		for j := i + 1; j < k; j++ {
+			indices[j] = indices[j-1] + 1
+		}
+	}
+}
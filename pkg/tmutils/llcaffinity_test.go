@@ -0,0 +1,145 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2020 Red Hat, Inc.
+ */
+
+package tmutils
+
+import "testing"
+
+// twoSocketLLCTopology models a 2-socket box, 4 cpus per socket, one socket-wide LLC each -
+// the same one-LLC-per-socket layout as machineinformer's twoSocketFixture, but with one
+// cpu per core instead of two SMT threads, expressed as the plain CPU-id-to-LLC mapping
+// GenerateLLCAffinityHints consumes.
+func twoSocketLLCTopology() LLCTopology {
+	topology := make(LLCTopology)
+	for socket := 0; socket < 2; socket++ {
+		for cpu := 0; cpu < 4; cpu++ {
+			topology[socket*4+cpu] = map[int]string{0: "socket0", 1: "socket1"}[socket]
+		}
+	}
+	return topology
+}
+
+func findHint(hints []TopologyHint, mask string) (TopologyHint, bool) {
+	for _, h := range hints {
+		if h.Mask == mask {
+			return h, true
+		}
+	}
+	return TopologyHint{}, false
+}
+
+func TestGenerateLLCAffinityHintsSameLLCIsPreferred(t *testing.T) {
+	hint := GenerateLLCAffinityHints("cpu", twoSocketLLCTopology(), 2)
+
+	// socket0's LLC alone (cpus 0-3) has enough CPUs for the request, so it comes back
+	// as its own preferred hint covering the whole LLC.
+	socket0Mask := NewCPUBitmaskFromSet(map[int]bool{0: true, 1: true, 2: true, 3: true}).String()
+	got, ok := findHint(hint.Hints, socket0Mask)
+	if !ok {
+		t.Fatalf("no hint for socket0's LLC: %#v", hint.Hints)
+	}
+	if !got.Preferred {
+		t.Errorf("socket0 alone (fits the request) Preferred = false, want true")
+	}
+}
+
+func TestGenerateLLCAffinityHintsCrossLLCIsNotPreferred(t *testing.T) {
+	hint := GenerateLLCAffinityHints("cpu", twoSocketLLCTopology(), 2)
+
+	// Spanning both sockets' LLCs is the only way to combine the 2 single-cpu-short
+	// groups a 3-cpu-per-group topology would produce; here it's just the "more than
+	// one LLC" case, covering every cpu on the host.
+	bothMask := NewCPUBitmaskFromSet(map[int]bool{0: true, 1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true}).String()
+	got, ok := findHint(hint.Hints, bothMask)
+	if !ok {
+		t.Fatalf("no hint spanning both sockets: %#v", hint.Hints)
+	}
+	if got.Preferred {
+		t.Errorf("spanning both sockets' LLCs Preferred = true, want false")
+	}
+}
+
+func TestGenerateLLCAffinityHintsResourceName(t *testing.T) {
+	hint := GenerateLLCAffinityHints("cpu", twoSocketLLCTopology(), 2)
+	if hint.Resource != "cpu" {
+		t.Errorf("hint.Resource = %q, want %q", hint.Resource, "cpu")
+	}
+}
+
+func TestGenerateLLCAffinityHintsIsBoundedByLLCCount(t *testing.T) {
+	// 2 distinct LLCs: one hint per single LLC that fits the request (2) plus one hint
+	// for the combination spanning both (C(2,1)+C(2,2) = 3), never C(8,2) = 28 - the
+	// count must scale with the number of LLCs, not the number of CPUs.
+	hint := GenerateLLCAffinityHints("cpu", twoSocketLLCTopology(), 2)
+	if len(hint.Hints) != 3 {
+		t.Errorf("got %d hints, want 3 (bounded by the 2 LLCs, not the 8 cpus)", len(hint.Hints))
+	}
+}
+
+func TestGenerateLLCAffinityHintsScalesWithLLCsNotCPUs(t *testing.T) {
+	// A host with 16 sockets of 8 cpus each (128 cpus total) must stay tractable:
+	// C(128, 8) would be astronomical, but this is bounded by C(16, k) <= 2^16.
+	topology := make(LLCTopology)
+	for socket := 0; socket < 16; socket++ {
+		for cpu := 0; cpu < 8; cpu++ {
+			topology[socket*8+cpu] = string(rune('A' + socket))
+		}
+	}
+	hint := GenerateLLCAffinityHints("cpu", topology, 8)
+	if len(hint.Hints) == 0 {
+		t.Fatalf("expected hints, got none")
+	}
+	if len(hint.Hints) > 1<<16 {
+		t.Fatalf("got %d hints, want at most 2^16 (bounded by LLC count, not CPU count)", len(hint.Hints))
+	}
+}
+
+// zenCCXLLCTopology models a Zen-style part with 4 CCXes of 4 cpus each, one LLC per CCX -
+// the same shape as machineinformer's zenCCXFixture.
+func zenCCXLLCTopology() LLCTopology {
+	topology := make(LLCTopology)
+	for ccx := 0; ccx < 4; ccx++ {
+		for core := 0; core < 4; core++ {
+			cpu := ccx*4 + core
+			topology[cpu] = []string{"ccx0", "ccx1", "ccx2", "ccx3"}[ccx]
+		}
+	}
+	return topology
+}
+
+func TestGenerateLLCAffinityHintsZenCCX(t *testing.T) {
+	hint := GenerateLLCAffinityHints("cpu", zenCCXLLCTopology(), 2)
+
+	// ccx1 alone (cpus 4-7) has enough cpus for the request.
+	ccx1Mask := NewCPUBitmaskFromSet(map[int]bool{4: true, 5: true, 6: true, 7: true}).String()
+	withinCCX, ok := findHint(hint.Hints, ccx1Mask)
+	if !ok {
+		t.Fatalf("no hint for ccx1 alone: %#v", hint.Hints)
+	}
+	if !withinCCX.Preferred {
+		t.Errorf("ccx1 alone (fits the request) Preferred = false, want true")
+	}
+
+	// ccx1+ccx2 combined is a 2-LLC group, never preferred.
+	acrossMask := NewCPUBitmaskFromSet(map[int]bool{4: true, 5: true, 6: true, 7: true, 8: true, 9: true, 10: true, 11: true}).String()
+	acrossCCX, ok := findHint(hint.Hints, acrossMask)
+	if !ok {
+		t.Fatalf("no hint for ccx1+ccx2: %#v", hint.Hints)
+	}
+	if acrossCCX.Preferred {
+		t.Errorf("ccx1+ccx2 (cross CCX) Preferred = true, want false")
+	}
+}